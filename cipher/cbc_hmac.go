@@ -24,7 +24,6 @@ import (
 	"crypto/subtle"
 	"encoding/binary"
 	"errors"
-	"github.com/apexskier/cryptoPadding"
 	"hash"
 )
 
@@ -32,6 +31,12 @@ const (
 	nonceBytes = 16
 )
 
+// errCryptoFailure is returned for any Open failure, whether it originates
+// from an auth tag mismatch or from invalid padding. The two cases are
+// deliberately indistinguishable to callers and take the same code path,
+// to avoid leaking which check failed.
+var errCryptoFailure = errors.New("square/go-jose: invalid ciphertext")
+
 // NewCBCHMAC instantiates a new AEAD based on CBC+HMAC.
 func NewCBCHMAC(key []byte, newBlockCipher func([]byte) (cipher.Block, error)) (cipher.AEAD, error) {
 	keySize := len(key) / 2
@@ -75,11 +80,7 @@ func (ctx *cbcAEAD) Seal(dst, nonce, plaintext, data []byte) []byte {
 	copy(ciphertext, plaintext)
 
 	cbc := cipher.NewCBCEncrypter(ctx.blockCipher, nonce)
-	padding := new(cryptoPadding.PKCS7)
-	ciphertext, err := padding.Pad(ciphertext, ctx.blockCipher.BlockSize())
-	if err != nil {
-		panic(err)
-	}
+	ciphertext = pkcs7Pad(ciphertext, ctx.blockCipher.BlockSize())
 
 	cbc.CryptBlocks(ciphertext, ciphertext)
 	authtag := ctx.computeAuthTag(data, nonce, ciphertext)
@@ -94,25 +95,34 @@ func (ctx *cbcAEAD) Seal(dst, nonce, plaintext, data []byte) []byte {
 // Open decrypts and authenticates the ciphertext.
 func (ctx *cbcAEAD) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
 	if len(ciphertext) < ctx.authtagBytes {
-		return nil, errors.New("square/go-jose: invalid ciphertext (too short)")
+		return nil, errCryptoFailure
 	}
 
 	offset := len(ciphertext) - ctx.authtagBytes
 	expectedTag := ctx.computeAuthTag(data, nonce, ciphertext[:offset])
-	match := subtle.ConstantTimeCompare(expectedTag, ciphertext[offset:])
-	if match != 1 {
-		return nil, errors.New("square/go-jose: invalid ciphertext (auth tag mismatch)")
+	tagMatch := subtle.ConstantTimeCompare(expectedTag, ciphertext[offset:])
+
+	// Always run the CBC decrypt and the constant-time unpad, regardless of
+	// the tag comparison result above, so that a bad auth tag and bad
+	// padding take the same amount of time and the same branches as success.
+	blockSize := ctx.blockCipher.BlockSize()
+	buffer := make([]byte, offset)
+	if offset%blockSize == 0 {
+		cbc := cipher.NewCBCDecrypter(ctx.blockCipher, nonce)
+		cbc.CryptBlocks(buffer, ciphertext[:offset])
+	} else {
+		// Not a valid multiple of the block size -- decryption can't
+		// proceed, but we still need to return in constant time relative to
+		// the valid-length case, so fall through with the zeroed buffer and
+		// let the unpad step fail below.
+		tagMatch = 0
 	}
 
-	cbc := cipher.NewCBCDecrypter(ctx.blockCipher, nonce)
-	buffer := []byte(ciphertext[:offset])
-	cbc.CryptBlocks(buffer, buffer)
+	plaintext, unpadOk := pkcs7Unpad(buffer, blockSize)
 
-	// Remove padding
-	padding := new(cryptoPadding.PKCS7)
-	plaintext, err := padding.Unpad(buffer, ctx.blockCipher.BlockSize())
-	if err != nil {
-		return nil, err
+	ok := subtle.ConstantTimeSelect(tagMatch, unpadOk, 0)
+	if ok != 1 {
+		return nil, errCryptoFailure
 	}
 
 	ret, out := resize(dst, len(dst)+len(plaintext))
@@ -123,11 +133,6 @@ func (ctx *cbcAEAD) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
 
 // Compute an authentication tag
 func (ctx *cbcAEAD) computeAuthTag(aad, nonce, ciphertext []byte) []byte {
-	buffer := []byte(aad)
-	buffer = append(buffer, nonce...)
-	buffer = append(buffer, ciphertext...)
-	buffer = append(buffer, bitLen(aad)...)
-
 	var hash func() hash.Hash
 	switch len(ctx.integrityKey) {
 	case 16:
@@ -138,12 +143,17 @@ func (ctx *cbcAEAD) computeAuthTag(aad, nonce, ciphertext []byte) []byte {
 		hash = sha512.New
 	}
 
-	hmac := hmac.New(hash, ctx.integrityKey)
+	mac := hmac.New(hash, ctx.integrityKey)
 
-	// According to documentation, Write() on hash.Hash never fails.
-	_, _ = hmac.Write(buffer)
+	// Stream the MAC input directly into the HMAC rather than building up
+	// an intermediate buffer with append -- Write() on hash.Hash never
+	// fails, so errors are safe to discard.
+	_, _ = mac.Write(aad)
+	_, _ = mac.Write(nonce)
+	_, _ = mac.Write(ciphertext)
+	_, _ = mac.Write(bitLen(aad))
 
-	return hmac.Sum(nil)[:ctx.authtagBytes]
+	return mac.Sum(nil)[:ctx.authtagBytes]
 }
 
 // Helper function for serializing bit length into array
@@ -153,6 +163,54 @@ func bitLen(input []byte) []byte {
 	return encodedLen
 }
 
+// pkcs7Pad appends PKCS#7 padding to data so that its length becomes a
+// multiple of blockSize. Since the padding length is never secret (it is a
+// deterministic function of the known plaintext length), this does not need
+// to run in constant time.
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padLen := blockSize - (len(data) % blockSize)
+	padded := append(data, make([]byte, padLen)...)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(padLen)
+	}
+	return padded
+}
+
+// pkcs7Unpad removes PKCS#7 padding from buffer, which must be a multiple of
+// blockSize. It runs in constant time with respect to the padding contents
+// and the claimed padding length: every byte in the last block is inspected
+// regardless of what the padding length byte says, and the function never
+// branches on secret data. It returns (plaintext, 1) on success. On failure
+// the second result is 0 and the first is nil if buffer is empty or not a
+// multiple of blockSize, or the whole of buffer if its padding is invalid.
+func pkcs7Unpad(buffer []byte, blockSize int) ([]byte, int) {
+	if len(buffer) == 0 || len(buffer)%blockSize != 0 {
+		return nil, 0
+	}
+
+	padLen := int(buffer[len(buffer)-1])
+
+	// good tracks whether the padding is well-formed so far; it is updated
+	// with bitwise operations only, never used in a branch.
+	good := subtle.ConstantTimeLessOrEq(1, padLen) & subtle.ConstantTimeLessOrEq(padLen, blockSize)
+
+	// Check every byte of the last block against the claimed pad length,
+	// regardless of whether padLen itself is in range, so the number of
+	// comparisons performed does not depend on secret data.
+	for i := 0; i < blockSize; i++ {
+		pos := len(buffer) - 1 - i
+		hasPad := subtle.ConstantTimeLessOrEq(i+1, padLen)
+		mismatch := subtle.ConstantTimeByteEq(buffer[pos], byte(padLen)) ^ 1
+		good &= 1 ^ (hasPad & mismatch)
+	}
+
+	// Fall back to a pad length of 0 when the padding was invalid, so the
+	// slice bound below is always within range without branching on padLen.
+	safePadLen := subtle.ConstantTimeSelect(good, padLen, 0)
+
+	return buffer[:len(buffer)-safePadLen], good
+}
+
 // resize ensures the the given slice has a capacity of at least n bytes.
 // If the capacity of the slice is less than n, a new slice is allocated
 // and the existing data will be copied.
@@ -0,0 +1,197 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+)
+
+func TestCBCHMACRoundTrip(t *testing.T) {
+	// Total key sizes of 32/48/64 bytes split the integrity key into
+	// 16/24/32 bytes, exercising all three HMAC hash choices.
+	for _, totalKeySize := range []int{32, 48, 64} {
+		key := make([]byte, totalKeySize)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+
+		aead, err := NewCBCHMAC(key, aes.NewCipher)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			t.Fatal(err)
+		}
+
+		// Sizes spanning block boundaries (AES block size is 16 bytes).
+		for _, size := range []int{0, 1, 15, 16, 17, 31, 32, 33, 100} {
+			plaintext := make([]byte, size)
+			if _, err := rand.Read(plaintext); err != nil {
+				t.Fatal(err)
+			}
+			aad := []byte("additional data")
+
+			ciphertext := aead.Seal(nil, nonce, plaintext, aad)
+			decrypted, err := aead.Open(nil, nonce, ciphertext, aad)
+			if err != nil {
+				t.Fatalf("keySize=%d size=%d: Open() error: %v", totalKeySize, size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("keySize=%d size=%d: round-tripped plaintext did not match", totalKeySize, size)
+			}
+		}
+	}
+}
+
+func TestCBCHMACBadAuthTag(t *testing.T) {
+	aead := newTestCBCHMAC(t)
+	nonce := make([]byte, aead.NonceSize())
+
+	ciphertext := aead.Seal(nil, nonce, []byte("attack at dawn"), nil)
+	ciphertext[len(ciphertext)-1] ^= 0x01
+
+	if _, err := aead.Open(nil, nonce, ciphertext, nil); err == nil {
+		t.Fatal("expected error for corrupted auth tag, got none")
+	}
+}
+
+func TestCBCHMACTruncatedCiphertext(t *testing.T) {
+	aead := newTestCBCHMAC(t)
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := aead.Open(nil, nonce, []byte("short"), nil); err == nil {
+		t.Fatal("expected error for ciphertext shorter than the auth tag, got none")
+	}
+}
+
+func TestCBCHMACMisalignedCiphertext(t *testing.T) {
+	aead := newTestCBCHMAC(t)
+	nonce := make([]byte, aead.NonceSize())
+
+	ciphertext := aead.Seal(nil, nonce, []byte("attack at dawn"), nil)
+
+	// Insert a single byte before the auth tag so the ciphertext portion is
+	// no longer a multiple of the block size, without touching the tag
+	// itself -- this must fail via the unpad/length path, not panic.
+	offset := len(ciphertext) - 16 // authtagBytes for the 16-byte integrity key of a 32-byte key
+	misaligned := append([]byte{}, ciphertext[:offset]...)
+	misaligned = append(misaligned, 0x00)
+	misaligned = append(misaligned, ciphertext[offset:]...)
+
+	if _, err := aead.Open(nil, nonce, misaligned, nil); err == nil {
+		t.Fatal("expected error for misaligned ciphertext, got none")
+	}
+}
+
+// TestCBCHMACBadPadding crafts a ciphertext whose auth tag is valid for its
+// (corrupted) contents, so that Open is forced down the padding-check path
+// rather than failing on the tag comparison -- exercising the
+// constant-time pkcs7Unpad rejection independently of the tag check.
+func TestCBCHMACBadPadding(t *testing.T) {
+	aead := newTestCBCHMAC(t).(*cbcAEAD)
+	nonce := make([]byte, aead.NonceSize())
+
+	// A single block of plaintext, so Seal's padding fills the entire
+	// second block with sixteen 0x10 bytes.
+	plaintext := make([]byte, aead.blockCipher.BlockSize())
+	ciphertext := aead.Seal(nil, nonce, plaintext, nil)
+
+	offset := len(ciphertext) - aead.authtagBytes
+	corrupted := append([]byte{}, ciphertext[:offset]...)
+
+	// CBC XORs the first ciphertext block into the decrypted second block,
+	// so flipping the first block's last byte turns the padding byte 0x10
+	// into 0xef, which is never a valid pad length.
+	corrupted[len(corrupted)-1-aead.blockCipher.BlockSize()] ^= 0xff
+
+	// Recompute the tag over the corrupted ciphertext so Open's tag check
+	// passes and the padding check is what actually fails.
+	tag := aead.computeAuthTag(nil, nonce, corrupted)
+	corrupted = append(corrupted, tag...)
+
+	if _, err := aead.Open(nil, nonce, corrupted, nil); err == nil {
+		t.Fatal("expected error for invalid padding with a valid auth tag, got none")
+	}
+}
+
+func TestPKCS7PadUnpadRoundTrip(t *testing.T) {
+	const blockSize = 16
+
+	for size := 0; size < 3*blockSize; size++ {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+
+		padded := pkcs7Pad(append([]byte{}, data...), blockSize)
+		if len(padded)%blockSize != 0 {
+			t.Fatalf("size=%d: padded length %d is not a multiple of block size", size, len(padded))
+		}
+
+		unpadded, ok := pkcs7Unpad(padded, blockSize)
+		if ok != 1 {
+			t.Fatalf("size=%d: unpad rejected validly padded data", size)
+		}
+		if !bytes.Equal(unpadded, data) {
+			t.Fatalf("size=%d: unpadded data did not match original", size)
+		}
+	}
+}
+
+func TestPKCS7UnpadInvalid(t *testing.T) {
+	const blockSize = 16
+
+	cases := []struct {
+		name   string
+		buffer []byte
+	}{
+		{"zero pad length", append(bytes.Repeat([]byte{1}, blockSize-1), 0x00)},
+		{"pad length too large", append(bytes.Repeat([]byte{1}, blockSize-1), 0xff)},
+		// Claims 2 bytes of padding, but the byte before the last doesn't
+		// match the claimed padding value.
+		{"inconsistent pad bytes", []byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0x00, 0x02}},
+		{"not a multiple of block size", make([]byte, blockSize+1)},
+	}
+
+	for _, c := range cases {
+		if _, ok := pkcs7Unpad(c.buffer, blockSize); ok == 1 {
+			t.Errorf("%s: expected rejection, got success", c.name)
+		}
+	}
+}
+
+func newTestCBCHMAC(t *testing.T) cipher.AEAD {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := NewCBCHMAC(key, aes.NewCipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return aead
+}
@@ -0,0 +1,92 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+import (
+	"crypto"
+	"encoding/binary"
+	"hash"
+	"io"
+)
+
+type concatKDF struct {
+	z, info []byte
+	i       uint32
+	cache   []byte
+	hasher  hash.Hash
+}
+
+// NewConcatKDF builds a KDF reader based on the key derivation function
+// from NIST SP 800-56A, as used by ECDH-ES in JOSE (RFC 7518, Section
+// 4.6). Each Read consumes output from a running sequence of hashes of a
+// big-endian round counter, the shared secret z, and the provided
+// OtherInfo fields (AlgorithmID, PartyUInfo, PartyVInfo, SuppPubInfo, and
+// SuppPrivInfo), caching any leftover bytes from a round for the next Read.
+func NewConcatKDF(hash crypto.Hash, z, algID, ptyUInfo, ptyVInfo, supPubInfo, supPrivInfo []byte) io.Reader {
+	buffer := append([]byte{}, algID...)
+	buffer = append(buffer, ptyUInfo...)
+	buffer = append(buffer, ptyVInfo...)
+	buffer = append(buffer, supPubInfo...)
+	buffer = append(buffer, supPrivInfo...)
+
+	return &concatKDF{
+		z:      z,
+		info:   buffer,
+		hasher: hash.New(),
+		cache:  []byte{},
+		i:      1,
+	}
+}
+
+func (ctx *concatKDF) Read(out []byte) (int, error) {
+	copied := copy(out, ctx.cache)
+	ctx.cache = ctx.cache[copied:]
+
+	for copied < len(out) {
+		ctx.hasher.Reset()
+
+		// Write the round counter
+		countBytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(countBytes, ctx.i)
+		_, err := ctx.hasher.Write(countBytes)
+		if err != nil {
+			return copied, err
+		}
+
+		// Write the shared secret
+		_, err = ctx.hasher.Write(ctx.z)
+		if err != nil {
+			return copied, err
+		}
+
+		// Write the OtherInfo
+		_, err = ctx.hasher.Write(ctx.info)
+		if err != nil {
+			return copied, err
+		}
+
+		// Increment the counter for the next round.
+		ctx.i++
+
+		hashed := ctx.hasher.Sum(nil)
+		n := copy(out[copied:], hashed)
+		ctx.cache = hashed[n:]
+		copied += n
+	}
+
+	return copied, nil
+}
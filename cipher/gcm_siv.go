@@ -0,0 +1,201 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	gcmSIVNonceSize = 12
+	gcmSIVTagSize   = 16
+)
+
+// NewGCMSIV returns an AEAD implementing AES-GCM-SIV (RFC 8452) for the
+// given key, which must be 16 or 32 bytes (AES-128 or AES-256). Unlike
+// A*GCM, a nonce reused across two messages under AES-GCM-SIV does not
+// break confidentiality of either message; it only reveals that the two
+// plaintexts (and AADs) were identical. It is otherwise a drop-in
+// cipher.AEAD, with the same 12-byte nonce and 16-byte tag sizes as AESGCM.
+func NewGCMSIV(key []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 16, 32:
+	default:
+		return nil, errors.New("square/go-jose: AES-GCM-SIV key must be 16 or 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcmSIV{block: block, keySize: len(key)}, nil
+}
+
+// gcmSIV implements cipher.AEAD per RFC 8452.
+type gcmSIV struct {
+	block   cipher.Block
+	keySize int
+}
+
+func (g *gcmSIV) NonceSize() int { return gcmSIVNonceSize }
+func (g *gcmSIV) Overhead() int  { return gcmSIVTagSize }
+
+// Seal encrypts and authenticates plaintext per RFC 8452 Section 4.
+func (g *gcmSIV) Seal(dst, nonce, plaintext, data []byte) []byte {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("square/go-jose: incorrect nonce length for AES-GCM-SIV")
+	}
+
+	authKey, encKey := g.deriveKeys(nonce)
+
+	tag := g.computeTag(authKey, encKey, nonce, data, plaintext)
+
+	ciphertext := make([]byte, len(plaintext))
+	g.ctr(encKey, tag, plaintext, ciphertext)
+
+	ret, out := resize(dst, len(dst)+len(ciphertext)+len(tag))
+	copy(out, ciphertext)
+	copy(out[len(ciphertext):], tag)
+
+	return ret
+}
+
+// Open decrypts and authenticates ciphertext per RFC 8452 Section 4.
+func (g *gcmSIV) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("square/go-jose: incorrect nonce length for AES-GCM-SIV")
+	}
+	if len(ciphertext) < gcmSIVTagSize {
+		return nil, errCryptoFailure
+	}
+
+	offset := len(ciphertext) - gcmSIVTagSize
+	tag := ciphertext[offset:]
+
+	authKey, encKey := g.deriveKeys(nonce)
+
+	plaintext := make([]byte, offset)
+	g.ctr(encKey, tag, ciphertext[:offset], plaintext)
+
+	expectedTag := g.computeTag(authKey, encKey, nonce, data, plaintext)
+	if subtle.ConstantTimeCompare(expectedTag, tag) != 1 {
+		return nil, errCryptoFailure
+	}
+
+	ret, out := resize(dst, len(dst)+len(plaintext))
+	copy(out, plaintext)
+
+	return ret, nil
+}
+
+// deriveKeys implements the key derivation of RFC 8452 Section 4: six (for
+// a 32-byte key) or four (for a 16-byte key) AES-encrypted counter blocks
+// of the form little_endian_uint32(i) || nonce, keeping the low 8 bytes of
+// each. The first 16 bytes produced are the record authentication key
+// (POLYVAL key); the rest are the record encryption key, the same length
+// as the input key.
+func (g *gcmSIV) deriveKeys(nonce []byte) (authKey, encKey []byte) {
+	numBlocks := g.keySize/8 + 2
+
+	material := make([]byte, 0, numBlocks*8)
+	var block [16]byte
+	var out [16]byte
+	copy(block[4:], nonce)
+
+	for i := 0; i < numBlocks; i++ {
+		binary.LittleEndian.PutUint32(block[:4], uint32(i))
+		g.block.Encrypt(out[:], block[:])
+		material = append(material, out[:8]...)
+	}
+
+	return material[:16], material[16:]
+}
+
+// computeTag implements the POLYVAL-based MAC of RFC 8452 Section 4: the
+// AAD and plaintext are zero-padded to a block boundary, POLYVAL'd under
+// authKey together with a trailing length block, then the nonce is XORed
+// into the low 96 bits of the result and the top bit is cleared before the
+// final AES encryption under encKey produces the tag.
+func (g *gcmSIV) computeTag(authKey, encKey, nonce, aad, plaintext []byte) []byte {
+	h := newPolyval(authKey)
+
+	h.updatePadded(aad)
+	h.updatePadded(plaintext)
+
+	var lengthBlock [16]byte
+	binary.LittleEndian.PutUint64(lengthBlock[0:8], uint64(len(aad))*8)
+	binary.LittleEndian.PutUint64(lengthBlock[8:16], uint64(len(plaintext))*8)
+	h.update(lengthBlock[:])
+
+	s := h.sum()
+
+	for i := 0; i < gcmSIVNonceSize; i++ {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+
+	tagBlock, err := aes.NewCipher(encKey)
+	if err != nil {
+		panic(err)
+	}
+
+	var tag [16]byte
+	tagBlock.Encrypt(tag[:], s[:])
+
+	return tag[:]
+}
+
+// ctr runs AES-CTR, keyed by encKey, over src into dst. The initial
+// counter block is tag with its top bit forced to 1, as specified by
+// RFC 8452; the counter itself occupies the low 32 bits of the block in
+// little-endian order and wraps modulo 2^32, independent of the upper 96
+// bits, which stay fixed for the whole message.
+func (g *gcmSIV) ctr(encKey, tag, src, dst []byte) {
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		panic(err)
+	}
+
+	var counterBlock [16]byte
+	copy(counterBlock[:], tag)
+	counterBlock[15] |= 0x80
+
+	counter := binary.LittleEndian.Uint32(counterBlock[:4])
+
+	var keystream [16]byte
+	for len(src) > 0 {
+		binary.LittleEndian.PutUint32(counterBlock[:4], counter)
+		block.Encrypt(keystream[:], counterBlock[:])
+
+		n := len(src)
+		if n > 16 {
+			n = 16
+		}
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ keystream[i]
+		}
+
+		src = src[n:]
+		dst = dst[n:]
+		counter++
+	}
+}
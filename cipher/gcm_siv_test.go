@@ -0,0 +1,157 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+// From RFC 8452, Appendix C.1 (AEAD_AES_128_GCM_SIV test vector 1): an
+// empty plaintext and empty AAD, which exercises key derivation and the
+// tag computation without involving the CTR keystream. POLYVAL here only
+// sees an all-zero length block, whose hash is zero under any key, so this
+// vector does not check the POLYVAL multiplication itself.
+func TestVectorGCMSIV(t *testing.T) {
+	key, err := hex.DecodeString("01000000000000000000000000000000"[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := hex.DecodeString("030000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := NewGCMSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := aead.Seal(nil, nonce, nil, nil)
+	want := "dc20e2d83f25705bb49e439eca56de25"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("Seal() = %x, want %s", got, want)
+	}
+}
+
+func TestGCMSIVRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, 15, 16, 17, 1000, 4096}
+
+	for _, keySize := range []int{16, 32} {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+
+		aead, err := NewGCMSIV(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, size := range sizes {
+			plaintext := make([]byte, size)
+			if _, err := rand.Read(plaintext); err != nil {
+				t.Fatal(err)
+			}
+			aad := []byte("additional data")
+
+			ciphertext := aead.Seal(nil, nonce, plaintext, aad)
+			decrypted, err := aead.Open(nil, nonce, ciphertext, aad)
+			if err != nil {
+				t.Fatalf("keySize=%d size=%d: Open() error: %v", keySize, size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("keySize=%d size=%d: round-tripped plaintext did not match", keySize, size)
+			}
+		}
+	}
+}
+
+func TestGCMSIVTamperDetection(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := NewGCMSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("attack at dawn")
+	aad := []byte("header")
+	ciphertext := aead.Seal(nil, nonce, plaintext, aad)
+
+	for i := range ciphertext {
+		corrupted := append([]byte(nil), ciphertext...)
+		corrupted[i] ^= 0x01
+		if _, err := aead.Open(nil, nonce, corrupted, aad); err == nil {
+			t.Fatalf("byte %d: expected error on corrupted ciphertext, got none", i)
+		}
+	}
+
+	if _, err := aead.Open(nil, nonce, ciphertext, []byte("wrong aad")); err == nil {
+		t.Fatal("expected error with mismatched AAD, got none")
+	}
+}
+
+// Nonce reuse is the entire point of AES-GCM-SIV: encrypting the same
+// plaintext and AAD under the same key and nonce twice must produce
+// identical output, unlike A*GCM where it would catastrophically break
+// confidentiality.
+func TestGCMSIVDeterministicUnderNonceReuse(t *testing.T) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := NewGCMSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("reused nonce, same plaintext")
+	aad := []byte("aad")
+
+	first := aead.Seal(nil, nonce, plaintext, aad)
+	second := aead.Seal(nil, nonce, plaintext, aad)
+	if !bytes.Equal(first, second) {
+		t.Fatal("expected identical ciphertext for repeated (key, nonce, plaintext, aad)")
+	}
+
+	third := aead.Seal(nil, nonce, []byte("different plaintext, same nonce"), aad)
+	if bytes.Equal(first, third) {
+		t.Fatal("expected different ciphertext for a different plaintext under the same nonce")
+	}
+}
@@ -0,0 +1,147 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"testing"
+)
+
+// Taken from RFC 5869, Appendix A.1-A.3.
+func TestVectorHKDF(t *testing.T) {
+	cases := []struct {
+		ikm, salt, info string
+		length          int
+		expected        string
+	}{
+		{
+			// A.1: basic test case with SHA-256
+			ikm:      "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			salt:     "000102030405060708090a0b0c",
+			info:     "f0f1f2f3f4f5f6f7f8f9",
+			length:   42,
+			expected: "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			// A.2: longer inputs/outputs with SHA-256
+			ikm:      "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f404142434445464748494a4b4c4d4e4f",
+			salt:     "606162636465666768696a6b6c6d6e6f707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9fa0a1a2a3a4a5a6a7a8a9aaabacadaeaf",
+			info:     "b0b1b2b3b4b5b6b7b8b9babbbcbdbebfc0c1c2c3c4c5c6c7c8c9cacbcccdcecfd0d1d2d3d4d5d6d7d8d9dadbdcdddedfe0e1e2e3e4e5e6e7e8e9eaebecedeeeff0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+			length:   82,
+			expected: "b11e398dc80327a1c8e7f78c596a49344f012eda2d4efad8a050cc4c19afa97c59045a99cac7827271cb41c65e590e09da3275600c2f09b8367793a9aca3db71cc30c58179ec3e87c14c01d5c1f3434f1d87",
+		},
+		{
+			// A.3: zero-length salt and info
+			ikm:      "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			salt:     "",
+			info:     "",
+			length:   42,
+			expected: "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+	}
+
+	for i, testCase := range cases {
+		ikm, err := hex.DecodeString(testCase.ikm)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		salt, err := hex.DecodeString(testCase.salt)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		info, err := hex.DecodeString(testCase.info)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		expected, err := hex.DecodeString(testCase.expected)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		hkdf := NewHKDF(crypto.SHA256, ikm, salt, info)
+
+		out := make([]byte, testCase.length)
+		if _, err := hkdf.Read(out); err != nil {
+			t.Errorf("case %d: error reading from hkdf reader: %v", i, err)
+			continue
+		}
+
+		if bytes.Compare(out, expected) != 0 {
+			t.Errorf("case %d: did not receive expected output from hkdf reader", i)
+		}
+	}
+}
+
+func TestHKDFCache(t *testing.T) {
+	ikm := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	salt := []byte{1, 2, 3, 4}
+	info := []byte{4, 3, 2, 1}
+
+	outputs := [][]byte{}
+
+	// Read the same amount of data in different chunk sizes
+	for i := 10; i <= 100; i++ {
+		out := make([]byte, 1024)
+		reader := NewHKDF(crypto.SHA256, ikm, salt, info)
+
+		for j := 0; j < len(out); j += i {
+			end := j + i
+			if end > len(out) {
+				end = len(out)
+			}
+			_, _ = reader.Read(out[j:end])
+		}
+
+		outputs = append(outputs, out)
+	}
+
+	for i := range outputs {
+		if bytes.Compare(outputs[i], outputs[0]) != 0 {
+			t.Error("not all outputs from HKDF matched")
+		}
+	}
+}
+
+func benchmarkHKDF(b *testing.B, total, chunksize int) {
+	ikm := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	salt := []byte{1, 2, 3, 4}
+	info := []byte{4, 3, 2, 1}
+
+	out := make([]byte, total)
+	reader := NewHKDF(crypto.SHA256, ikm, salt, info)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < total/chunksize; j++ {
+			_, _ = reader.Read(out[j*chunksize:])
+		}
+	}
+}
+
+func BenchmarkHKDF_4k_64(b *testing.B) {
+	benchmarkHKDF(b, 4096, 64)
+}
+
+func BenchmarkHKDF_4k_1024(b *testing.B) {
+	benchmarkHKDF(b, 4096, 1024)
+}
@@ -0,0 +1,146 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+// polyval implements the POLYVAL universal hash function used by
+// AES-GCM-SIV (RFC 8452, Section 3): GF(2^128) multiplication under the
+// reduction polynomial x^128 + x^127 + x^126 + x^121 + 1, with an
+// additional implicit factor of x^-128 relative to plain field
+// multiplication.
+//
+// Rather than implement that field arithmetic directly, this uses the
+// documented equivalence between POLYVAL and GHASH (RFC 8452, Appendix A):
+// POLYVAL(H, X) == byteReverse(GHASH(mulX(byteReverse(H)), byteReverse(X))),
+// where byteReverse reverses the order of the 16 bytes of a block and mulX
+// multiplies by x in GHASH's field. This lets the well-known (and
+// easy-to-get-right) GHASH doubling-with-reduction-byte construction do the
+// actual work, reusing the reduction constant 0xe1 rather than POLYVAL's
+// native one.
+type polyval struct {
+	h [16]byte // POLYVAL key, byte-reversed and multiplied by x for ghashMul
+	s [16]byte // running state, in GHASH's byte-reversed domain
+}
+
+// newPolyval constructs a POLYVAL instance keyed by the 16-byte key h.
+func newPolyval(h []byte) *polyval {
+	p := &polyval{}
+	var key [16]byte
+	copy(key[:], h)
+	p.h = byteReverse128(key)
+
+	// Multiply the key by x in GHASH's field.
+	lsb := p.h[15] & 1
+	p.h = shiftRight1(p.h)
+	p.h[0] ^= ghashReduction[0] & -lsb
+	return p
+}
+
+// update folds full 16-byte blocks of data into the running state. len(data)
+// must be a multiple of 16.
+func (p *polyval) update(data []byte) {
+	for len(data) > 0 {
+		var x [16]byte
+		copy(x[:], data[:16])
+		x = byteReverse128(x)
+
+		for i := range p.s {
+			p.s[i] ^= x[i]
+		}
+		p.s = ghashMul(p.s, p.h)
+
+		data = data[16:]
+	}
+}
+
+// updatePadded folds data into the running state, first zero-padding it out
+// to a multiple of 16 bytes as RFC 8452 requires for the AAD and plaintext
+// inputs to the per-message POLYVAL computation.
+func (p *polyval) updatePadded(data []byte) {
+	full := len(data) - len(data)%16
+	if full > 0 {
+		p.update(data[:full])
+	}
+
+	rem := data[full:]
+	if len(rem) == 0 {
+		return
+	}
+
+	var last [16]byte
+	copy(last[:], rem)
+	p.update(last[:])
+}
+
+// sum returns the 16-byte POLYVAL digest of everything folded in so far.
+func (p *polyval) sum() [16]byte {
+	return byteReverse128(p.s)
+}
+
+// byteReverse128 reverses the order of the 16 bytes of x: byte i of the
+// input becomes byte (15-i) of the output.
+func byteReverse128(x [16]byte) [16]byte {
+	var out [16]byte
+	for i := 0; i < 16; i++ {
+		out[15-i] = x[i]
+	}
+	return out
+}
+
+// ghashReduction is the GHASH reduction constant for x^128 mod the GCM
+// field polynomial x^128 + x^7 + x^2 + x + 1, in GHASH's
+// bit-reflected, MSB-first representation (top byte 0xe1, rest zero).
+var ghashReduction = [16]byte{0xe1}
+
+// ghashMul multiplies x and y in GHASH's GF(2^128), via the standard
+// shift-and-reduce double-and-add algorithm (NIST SP 800-38D, Algorithm
+// 1). The conditional XORs are driven by byte masks derived from the
+// relevant bit, rather than branches, so the sequence of operations does
+// not depend on the (secret) bits of either operand.
+func ghashMul(x, y [16]byte) [16]byte {
+	var z, v [16]byte
+	v = y
+
+	for i := 0; i < 128; i++ {
+		bit := (x[i/8] >> uint(7-i%8)) & 1
+		mask := -bit // 0x00 or 0xff
+
+		for j := range z {
+			z[j] ^= v[j] & mask
+		}
+
+		lsb := v[15] & 1
+		v = shiftRight1(v)
+
+		redMask := -lsb
+		for j := range v {
+			v[j] ^= ghashReduction[j] & redMask
+		}
+	}
+
+	return z
+}
+
+// shiftRight1 shifts the 128-bit big-endian value v right by one bit.
+func shiftRight1(v [16]byte) [16]byte {
+	var out [16]byte
+	var carry byte
+	for i := 0; i < 16; i++ {
+		out[i] = (v[i] >> 1) | (carry << 7)
+		carry = v[i] & 1
+	}
+	return out
+}
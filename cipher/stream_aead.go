@@ -0,0 +1,289 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Wire format, repeated once per chunk:
+//
+//	finalFlag byte   -- 0 for a data chunk, 1 for the terminating chunk
+//	chunkLen  uint32 -- big-endian length of the ciphertext that follows
+//	chunkData []byte -- AEAD-sealed chunk, chunkLen bytes
+//
+// The terminating chunk always carries an empty plaintext and exists solely
+// so a reader can tell a clean end-of-stream apart from a truncated one: if
+// the underlying reader hits EOF before a finalFlag-1 chunk has been seen,
+// NewDecryptReader returns an error instead of silently returning a short
+// stream.
+const (
+	streamChunkHeaderSize = 1 + 4
+	streamFinalFlag       = 1
+	streamDataFlag        = 0
+)
+
+// ErrStreamTruncated is returned by a StreamAEAD reader when the underlying
+// stream ends before the terminating chunk has been seen.
+var ErrStreamTruncated = errors.New("square/go-jose: truncated stream (missing final chunk)")
+
+// errStreamChunk is returned for any malformed or inauthentic chunk. As
+// with cbcAEAD.Open, the failure modes (bad length, bad tag) are folded
+// into one generic error so a caller can't distinguish them.
+var errStreamChunk = errors.New("square/go-jose: invalid stream chunk")
+
+// deriveChunkNonce computes the per-chunk nonce for chunkIndex, given the
+// AEAD's required nonce size and a per-file random nonce. Binding every
+// chunk's nonce to both the file nonce and its index, via HMAC-SHA256,
+// ensures that no two chunks -- whether in the same stream or across two
+// different streams encrypted with the same AEAD key -- ever reuse a nonce.
+func deriveChunkNonce(fileNonce []byte, chunkIndex uint64, nonceSize int) []byte {
+	var indexBytes [8]byte
+	binary.BigEndian.PutUint64(indexBytes[:], chunkIndex)
+
+	mac := hmac.New(sha256.New, fileNonce)
+	_, _ = mac.Write(indexBytes[:])
+
+	return mac.Sum(nil)[:nonceSize]
+}
+
+// chunkAAD builds the additional authenticated data for chunkIndex, binding
+// the chunk to its position and to the file it belongs to so that chunks
+// cannot be reordered, truncated, or spliced in from another file without
+// being detected by the AEAD tag check.
+func chunkAAD(fileNonce []byte, chunkIndex uint64, final byte) []byte {
+	aad := make([]byte, 0, len(fileNonce)+8+1)
+	aad = append(aad, fileNonce...)
+
+	var indexBytes [8]byte
+	binary.BigEndian.PutUint64(indexBytes[:], chunkIndex)
+	aad = append(aad, indexBytes[:]...)
+
+	return append(aad, final)
+}
+
+// streamEncryptWriter implements io.WriteCloser, framing and sealing writes
+// into fixed-size authenticated chunks as described above.
+type streamEncryptWriter struct {
+	w         io.Writer
+	aead      cipher.AEAD
+	fileNonce []byte
+	chunkSize int
+	buf       []byte
+	index     uint64
+	closed    bool
+	err       error
+}
+
+// NewEncryptWriter returns an io.WriteCloser that encrypts everything
+// written to it, in fixed-size chunkSize plaintext chunks, and writes the
+// resulting framed ciphertext to w. It is suitable for streaming payloads
+// too large to hold in memory. The caller must call Close to flush any
+// buffered plaintext and to write the terminating chunk; failing to do so
+// produces a stream that NewDecryptReader will reject as truncated.
+//
+// fileNonce must be unique per stream (e.g. a fresh random value per file)
+// and at least as long as aead's nonce size; it is not itself used as an
+// AEAD nonce but as the key to the per-chunk nonce derivation.
+func NewEncryptWriter(w io.Writer, aead cipher.AEAD, fileNonce []byte, chunkSize int) io.WriteCloser {
+	if chunkSize <= 0 {
+		panic("square/go-jose: chunkSize must be positive")
+	}
+
+	return &streamEncryptWriter{
+		w:         w,
+		aead:      aead,
+		fileNonce: fileNonce,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+	}
+}
+
+func (s *streamEncryptWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.closed {
+		return 0, errors.New("square/go-jose: write to closed stream writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+
+		if len(s.buf) == s.chunkSize {
+			if err := s.flushChunk(streamDataFlag); err != nil {
+				s.err = err
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// flushChunk seals the buffered plaintext (which may be shorter than
+// chunkSize for the last data chunk) and writes the framed chunk to the
+// underlying writer, then resets the buffer.
+func (s *streamEncryptWriter) flushChunk(final byte) error {
+	nonce := deriveChunkNonce(s.fileNonce, s.index, s.aead.NonceSize())
+	aad := chunkAAD(s.fileNonce, s.index, final)
+
+	sealed := s.aead.Seal(nil, nonce, s.buf, aad)
+
+	var header [streamChunkHeaderSize]byte
+	header[0] = final
+	binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+
+	if _, err := s.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(sealed); err != nil {
+		return err
+	}
+
+	s.buf = s.buf[:0]
+	s.index++
+	return nil
+}
+
+// Close flushes any buffered plaintext and writes the terminating chunk.
+func (s *streamEncryptWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.flushChunk(streamDataFlag); err != nil {
+		return err
+	}
+	return s.flushChunk(streamFinalFlag)
+}
+
+// streamDecryptReader implements io.Reader, the inverse of
+// streamEncryptWriter.
+type streamDecryptReader struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	fileNonce []byte
+	chunkSize int
+	index     uint64
+	pending   []byte
+	done      bool
+	err       error
+}
+
+// NewDecryptReader returns an io.Reader that verifies and decrypts a stream
+// produced by NewEncryptWriter with the same aead, fileNonce, and
+// chunkSize. It returns ErrStreamTruncated if the underlying reader ends
+// before the terminating chunk is seen, and a generic error for any chunk
+// that fails authentication -- including chunks reordered, dropped, or
+// spliced in from a different file, since each chunk's AEAD tag is bound to
+// its index and to fileNonce.
+func NewDecryptReader(r io.Reader, aead cipher.AEAD, fileNonce []byte, chunkSize int) io.Reader {
+	if chunkSize <= 0 {
+		panic("square/go-jose: chunkSize must be positive")
+	}
+
+	return &streamDecryptReader{
+		r:         r,
+		aead:      aead,
+		fileNonce: fileNonce,
+		chunkSize: chunkSize,
+	}
+}
+
+func (s *streamDecryptReader) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		if err := s.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+
+	if n == 0 && s.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// readChunk reads, authenticates, and decrypts the next chunk from the
+// underlying reader, storing its plaintext in s.pending.
+func (s *streamDecryptReader) readChunk() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.done {
+		return io.EOF
+	}
+
+	var header [streamChunkHeaderSize]byte
+	if _, err := io.ReadFull(s.r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			s.err = ErrStreamTruncated
+		} else {
+			s.err = err
+		}
+		return s.err
+	}
+
+	final := header[0]
+	chunkLen := binary.BigEndian.Uint32(header[1:])
+
+	maxChunkLen := uint32(s.chunkSize + s.aead.Overhead())
+	if chunkLen > maxChunkLen {
+		s.err = errStreamChunk
+		return s.err
+	}
+
+	sealed := make([]byte, chunkLen)
+	if _, err := io.ReadFull(s.r, sealed); err != nil {
+		s.err = ErrStreamTruncated
+		return s.err
+	}
+
+	nonce := deriveChunkNonce(s.fileNonce, s.index, s.aead.NonceSize())
+	aad := chunkAAD(s.fileNonce, s.index, final)
+
+	plaintext, err := s.aead.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		s.err = errStreamChunk
+		return s.err
+	}
+
+	s.index++
+	s.pending = plaintext
+
+	if final == streamFinalFlag {
+		s.done = true
+	}
+
+	return nil
+}
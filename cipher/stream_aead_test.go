@@ -0,0 +1,229 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package josecipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func newTestGCM(t *testing.T) cipher.AEAD {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+func encryptStream(t *testing.T, aead cipher.AEAD, fileNonce, plaintext []byte, chunkSize int) []byte {
+	var buf bytes.Buffer
+	w := NewEncryptWriter(&buf, aead, fileNonce, chunkSize)
+
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	aead := newTestGCM(t)
+	fileNonce := make([]byte, 16)
+	if _, err := rand.Read(fileNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := []int{0, 1, 15, 16, 17, 1000, 4096, 4096*3 + 7}
+
+	for _, size := range sizes {
+		plaintext := make([]byte, size)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+
+		encrypted := encryptStream(t, aead, fileNonce, plaintext, 16)
+
+		r := NewDecryptReader(bytes.NewReader(encrypted), aead, fileNonce, 16)
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: unexpected error: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("size %d: round-tripped plaintext did not match", size)
+		}
+	}
+}
+
+func TestStreamPartialReads(t *testing.T) {
+	aead := newTestGCM(t)
+	fileNonce := make([]byte, 16)
+	if _, err := rand.Read(fileNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 10000)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := encryptStream(t, aead, fileNonce, plaintext, 64)
+
+	r := NewDecryptReader(bytes.NewReader(encrypted), aead, fileNonce, 64)
+
+	var out bytes.Buffer
+	small := make([]byte, 3)
+	for {
+		n, err := r.Read(small)
+		out.Write(small[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error on partial read: %v", err)
+		}
+	}
+
+	if !bytes.Equal(out.Bytes(), plaintext) {
+		t.Fatal("partial-read round trip did not match original plaintext")
+	}
+}
+
+func TestStreamTruncationDetected(t *testing.T) {
+	aead := newTestGCM(t)
+	fileNonce := make([]byte, 16)
+	if _, err := rand.Read(fileNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 1000)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := encryptStream(t, aead, fileNonce, plaintext, 64)
+
+	// The terminating chunk is 21 bytes (a 5-byte header plus the 16-byte
+	// GCM tag over an empty plaintext). Cutting 20 bytes leaves every data
+	// chunk intact and only the first byte of the terminating chunk's
+	// header, to simulate truncation.
+	truncated := encrypted[:len(encrypted)-20]
+
+	r := NewDecryptReader(bytes.NewReader(truncated), aead, fileNonce, 64)
+	_, err := io.ReadAll(r)
+	if err != ErrStreamTruncated {
+		t.Fatalf("expected ErrStreamTruncated, got %v", err)
+	}
+}
+
+func TestStreamCorruptionAtArbitraryOffset(t *testing.T) {
+	aead := newTestGCM(t)
+	fileNonce := make([]byte, 16)
+	if _, err := rand.Read(fileNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 1000)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	original := encryptStream(t, aead, fileNonce, plaintext, 64)
+
+	for _, offset := range []int{0, 1, 5, 64, 200, len(original) - 1} {
+		corrupted := append([]byte(nil), original...)
+		corrupted[offset] ^= 0xff
+
+		r := NewDecryptReader(bytes.NewReader(corrupted), aead, fileNonce, 64)
+		if _, err := io.ReadAll(r); err == nil {
+			t.Fatalf("offset %d: expected error on corrupted stream, got none", offset)
+		}
+	}
+}
+
+func TestStreamRejectsNonPositiveChunkSize(t *testing.T) {
+	aead := newTestGCM(t)
+	fileNonce := make([]byte, 16)
+
+	for _, chunkSize := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("chunkSize %d: expected panic from NewEncryptWriter, got none", chunkSize)
+				}
+			}()
+			NewEncryptWriter(&bytes.Buffer{}, aead, fileNonce, chunkSize)
+		}()
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("chunkSize %d: expected panic from NewDecryptReader, got none", chunkSize)
+				}
+			}()
+			NewDecryptReader(bytes.NewReader(nil), aead, fileNonce, chunkSize)
+		}()
+	}
+}
+
+func TestStreamChunkSubstitutionAcrossFiles(t *testing.T) {
+	aead := newTestGCM(t)
+
+	fileNonceA := bytes.Repeat([]byte{0xaa}, 16)
+	fileNonceB := bytes.Repeat([]byte{0xbb}, 16)
+
+	plaintextA := bytes.Repeat([]byte("file-A-chunk-data..."), 10)
+	plaintextB := bytes.Repeat([]byte("file-B-chunk-data..."), 10)
+
+	encA := encryptStream(t, aead, fileNonceA, plaintextA, 32)
+	encB := encryptStream(t, aead, fileNonceB, plaintextB, 32)
+
+	// Splice file B's first chunk into file A's stream in place of its own
+	// first chunk of identical on-wire length, then try to decrypt as file A.
+	headerLen := streamChunkHeaderSize
+	chunkLenA := headerLen + int(bigEndianLen(encA[1:headerLen]))
+	chunkLenB := headerLen + int(bigEndianLen(encB[1:headerLen]))
+	if chunkLenA != chunkLenB {
+		t.Fatal("test setup assumption violated: chunk lengths differ")
+	}
+
+	spliced := append([]byte(nil), encB[:chunkLenB]...)
+	spliced = append(spliced, encA[chunkLenA:]...)
+
+	r := NewDecryptReader(bytes.NewReader(spliced), aead, fileNonceA, 32)
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("expected error when splicing a chunk from another file, got none")
+	}
+}
+
+func bigEndianLen(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
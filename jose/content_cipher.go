@@ -0,0 +1,101 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+
+	josecipher "github.com/nguyentuythi/go-jose/cipher"
+)
+
+// contentCipher builds the cipher.AEAD for one ContentEncryption algorithm
+// from a content encryption key (CEK) of the algorithm's required size.
+// Encrypter and Decrypter look the right one up by algorithm name rather
+// than switching on it inline, so that adding an algorithm is a matter of
+// registering an entry here instead of touching Encrypt/Decrypt.
+type contentCipher interface {
+	newAEAD(cek []byte) (cipher.AEAD, error)
+	keySize() int
+}
+
+// contentCiphers holds one entry per supported ContentEncryption, including
+// the repo-local AES-GCM-SIV and CBC+HMAC-over-StreamAEAD variants built on
+// josecipher.
+var contentCiphers = map[ContentEncryption]contentCipher{
+	A128CBC_HS256:        cbcHMACCipher{keySizeBytes: 32, newBlockCipher: aes.NewCipher},
+	A192CBC_HS384:        cbcHMACCipher{keySizeBytes: 48, newBlockCipher: aes.NewCipher},
+	A256CBC_HS512:        cbcHMACCipher{keySizeBytes: 64, newBlockCipher: aes.NewCipher},
+	A256CBC_HS512_STREAM: cbcHMACCipher{keySizeBytes: 64, newBlockCipher: aes.NewCipher},
+	A128GCM:              gcmCipher{keySizeBytes: 16},
+	A192GCM:              gcmCipher{keySizeBytes: 24},
+	A256GCM:              gcmCipher{keySizeBytes: 32},
+	A128GCM_SIV:          gcmSIVCipher{keySizeBytes: 16},
+	A256GCM_SIV:          gcmSIVCipher{keySizeBytes: 32},
+}
+
+// cbcHMACCipher wraps josecipher.NewCBCHMAC. It backs both A*CBC-HS* and
+// the A256CBC_HS512_STREAM variant: the AEAD it builds is the same either
+// way, the difference between the two is only in how Encrypter/Decrypter
+// drive it (Encrypt/Decrypt for the former, EncryptStream/DecryptStream
+// for the latter).
+type cbcHMACCipher struct {
+	keySizeBytes   int
+	newBlockCipher func([]byte) (cipher.Block, error)
+}
+
+func (c cbcHMACCipher) newAEAD(cek []byte) (cipher.AEAD, error) {
+	return josecipher.NewCBCHMAC(cek, c.newBlockCipher)
+}
+
+func (c cbcHMACCipher) keySize() int { return c.keySizeBytes }
+
+// gcmCipher wraps the standard library's AES-GCM.
+type gcmCipher struct {
+	keySizeBytes int
+}
+
+func (c gcmCipher) newAEAD(cek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c gcmCipher) keySize() int { return c.keySizeBytes }
+
+// gcmSIVCipher wraps josecipher.NewGCMSIV.
+type gcmSIVCipher struct {
+	keySizeBytes int
+}
+
+func (c gcmSIVCipher) newAEAD(cek []byte) (cipher.AEAD, error) {
+	return josecipher.NewGCMSIV(cek)
+}
+
+func (c gcmSIVCipher) keySize() int { return c.keySizeBytes }
+
+// isStreaming reports whether alg must be driven through
+// Encrypter.EncryptStream/Decrypter.DecryptStream rather than
+// Encrypter.Encrypt/Decrypter.Decrypt.
+func isStreaming(alg ContentEncryption) bool {
+	return alg == A256CBC_HS512_STREAM
+}
+
+var errWrongMode = errors.New("square/go-jose: wrong Encrypt/Decrypt method for this ContentEncryption")
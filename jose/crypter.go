@@ -0,0 +1,135 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jose
+
+import (
+	stdcipher "crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	josecipher "github.com/nguyentuythi/go-jose/cipher"
+)
+
+// Encrypter encrypts plaintext under a single ContentEncryption algorithm
+// and content encryption key (CEK). It looks the algorithm up in
+// contentCiphers rather than switching on it, so that AES-GCM-SIV-backed
+// algorithms are driven through the same Encrypt call site as the CBC+HMAC
+// and GCM ones. The StreamAEAD-backed A256CBC_HS512_STREAM goes through
+// EncryptStream instead, and Encrypt rejects it.
+type Encrypter struct {
+	alg  ContentEncryption
+	aead stdcipher.AEAD
+	cek  []byte
+}
+
+// NewEncrypter returns an Encrypter for alg using cek as the content
+// encryption key. cek must be exactly as long as alg requires; any other
+// length is an error.
+func NewEncrypter(alg ContentEncryption, cek []byte) (*Encrypter, error) {
+	cc, ok := contentCiphers[alg]
+	if !ok {
+		return nil, errors.New("square/go-jose: unsupported ContentEncryption: " + string(alg))
+	}
+	if len(cek) != cc.keySize() {
+		return nil, errors.New("square/go-jose: invalid content encryption key size for " + string(alg))
+	}
+
+	aead, err := cc.newAEAD(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encrypter{alg: alg, aead: aead, cek: cek}, nil
+}
+
+// Encrypt seals plaintext under a freshly generated nonce, authenticating
+// aad alongside it, and returns the nonce and sealed ciphertext (with the
+// AEAD's tag appended, per the cipher.AEAD convention). It returns
+// errWrongMode if e's algorithm is streaming-only.
+func (e *Encrypter) Encrypt(aad, plaintext []byte) (nonce, ciphertext []byte, err error) {
+	if isStreaming(e.alg) {
+		return nil, nil, errWrongMode
+	}
+
+	nonce = make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return nonce, e.aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// EncryptStream returns a writer that frames and seals everything written
+// to it into StreamAEAD chunks of chunkSize plaintext bytes, using e's CEK.
+// It is only valid for streaming algorithms such as A256CBC_HS512_STREAM;
+// callers must Close the returned writer to flush the terminating chunk.
+func (e *Encrypter) EncryptStream(w io.Writer, fileNonce []byte, chunkSize int) (io.WriteCloser, error) {
+	if !isStreaming(e.alg) {
+		return nil, errWrongMode
+	}
+
+	return josecipher.NewEncryptWriter(w, e.aead, fileNonce, chunkSize), nil
+}
+
+// Decrypter decrypts ciphertext under a single ContentEncryption algorithm
+// and CEK -- the inverse of Encrypter.
+type Decrypter struct {
+	alg  ContentEncryption
+	aead stdcipher.AEAD
+}
+
+// NewDecrypter returns a Decrypter for alg using cek as the content
+// encryption key, under the same constraints as NewEncrypter.
+func NewDecrypter(alg ContentEncryption, cek []byte) (*Decrypter, error) {
+	cc, ok := contentCiphers[alg]
+	if !ok {
+		return nil, errors.New("square/go-jose: unsupported ContentEncryption: " + string(alg))
+	}
+	if len(cek) != cc.keySize() {
+		return nil, errors.New("square/go-jose: invalid content encryption key size for " + string(alg))
+	}
+
+	aead, err := cc.newAEAD(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decrypter{alg: alg, aead: aead}, nil
+}
+
+// Decrypt authenticates and opens ciphertext sealed under nonce and aad by
+// a matching Encrypter. It returns errWrongMode if d's algorithm is
+// streaming-only.
+func (d *Decrypter) Decrypt(aad, nonce, ciphertext []byte) ([]byte, error) {
+	if isStreaming(d.alg) {
+		return nil, errWrongMode
+	}
+
+	return d.aead.Open(nil, nonce, ciphertext, aad)
+}
+
+// DecryptStream returns a reader that authenticates and decrypts a
+// StreamAEAD stream produced by a matching EncryptStream call. It is only
+// valid for streaming algorithms such as A256CBC_HS512_STREAM.
+func (d *Decrypter) DecryptStream(r io.Reader, fileNonce []byte, chunkSize int) (io.Reader, error) {
+	if !isStreaming(d.alg) {
+		return nil, errWrongMode
+	}
+
+	return josecipher.NewDecryptReader(r, d.aead, fileNonce, chunkSize), nil
+}
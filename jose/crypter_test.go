@@ -0,0 +1,158 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jose
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func TestEncrypterDecrypterRoundTrip(t *testing.T) {
+	for alg, cc := range contentCiphers {
+		if isStreaming(alg) {
+			continue
+		}
+
+		cek := make([]byte, cc.keySize())
+		if _, err := rand.Read(cek); err != nil {
+			t.Fatal(err)
+		}
+
+		enc, err := NewEncrypter(alg, cek)
+		if err != nil {
+			t.Fatalf("%s: NewEncrypter: %v", alg, err)
+		}
+		dec, err := NewDecrypter(alg, cek)
+		if err != nil {
+			t.Fatalf("%s: NewDecrypter: %v", alg, err)
+		}
+
+		plaintext := []byte("the quick brown fox jumps over the lazy dog")
+		aad := []byte("header")
+
+		nonce, ciphertext, err := enc.Encrypt(aad, plaintext)
+		if err != nil {
+			t.Fatalf("%s: Encrypt: %v", alg, err)
+		}
+
+		got, err := dec.Decrypt(aad, nonce, ciphertext)
+		if err != nil {
+			t.Fatalf("%s: Decrypt: %v", alg, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("%s: round-tripped plaintext did not match", alg)
+		}
+	}
+}
+
+func TestEncrypterRejectsWrongKeySize(t *testing.T) {
+	if _, err := NewEncrypter(A256GCM, make([]byte, 10)); err == nil {
+		t.Fatal("expected error for undersized CEK, got none")
+	}
+}
+
+func TestEncrypterRejectsUnknownAlgorithm(t *testing.T) {
+	if _, err := NewEncrypter(ContentEncryption("bogus"), make([]byte, 16)); err == nil {
+		t.Fatal("expected error for unsupported ContentEncryption, got none")
+	}
+}
+
+func TestOneShotAlgorithmsRejectStreamMethods(t *testing.T) {
+	cek := make([]byte, 32)
+	enc, err := NewEncrypter(A256GCM, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewDecrypter(A256GCM, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := enc.EncryptStream(&bytes.Buffer{}, make([]byte, 16), 64); err != errWrongMode {
+		t.Fatalf("expected errWrongMode from EncryptStream, got %v", err)
+	}
+	if _, err := dec.DecryptStream(bytes.NewReader(nil), make([]byte, 16), 64); err != errWrongMode {
+		t.Fatalf("expected errWrongMode from DecryptStream, got %v", err)
+	}
+}
+
+func TestStreamAlgorithmRejectsOneShotMethods(t *testing.T) {
+	cek := make([]byte, 64)
+	enc, err := NewEncrypter(A256CBC_HS512_STREAM, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewDecrypter(A256CBC_HS512_STREAM, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := enc.Encrypt(nil, []byte("x")); err != errWrongMode {
+		t.Fatalf("expected errWrongMode from Encrypt, got %v", err)
+	}
+	if _, err := dec.Decrypt(nil, make([]byte, 16), []byte("x")); err != errWrongMode {
+		t.Fatalf("expected errWrongMode from Decrypt, got %v", err)
+	}
+}
+
+func TestStreamRoundTripThroughEncrypter(t *testing.T) {
+	cek := make([]byte, 64)
+	if _, err := rand.Read(cek); err != nil {
+		t.Fatal(err)
+	}
+	fileNonce := make([]byte, 16)
+	if _, err := rand.Read(fileNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := NewEncrypter(A256CBC_HS512_STREAM, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := NewDecrypter(A256CBC_HS512_STREAM, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := bytes.Repeat([]byte("stream me "), 500)
+
+	var buf bytes.Buffer
+	w, err := enc.EncryptStream(&buf, fileNonce, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := dec.DecryptStream(&buf, fileNonce, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatal("streamed round trip did not match original plaintext")
+	}
+}
@@ -0,0 +1,82 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jose
+
+import (
+	"crypto"
+	"errors"
+
+	josecipher "github.com/nguyentuythi/go-jose/cipher"
+)
+
+// keyDeriver derives the key-wrapping key of keySize bytes for a
+// KeyAlgorithm from the secret the key agreement or key-wrap step already
+// produced (an ECDH shared secret, or a password-derived key for PBES2),
+// plus the PartyUInfo/PartyVInfo the two sides agreed on out of band.
+//
+// Unlike the ConcatKDF-based key agreement algorithms this repo already
+// supports, the draft profiles registered below all derive their key
+// through josecipher.NewHKDF, binding apu/apv into the HKDF info field
+// instead of ConcatKDF's OtherInfo structure.
+type keyDeriver interface {
+	deriveKey(secret, apu, apv []byte, keySize int) ([]byte, error)
+}
+
+// keyDerivers holds one entry per KeyAlgorithm that derives its key via
+// HKDF rather than via ConcatKDF (ECDH-ES, ECDH-ES+A*KW) or by using a key
+// already at the right size (A*KW, A*GCMKW).
+var keyDerivers = map[KeyAlgorithm]keyDeriver{
+	ECDH_SS_A128KW:          hkdfKeyDeriver{hash: crypto.SHA256},
+	ECDH_SS_A192KW:          hkdfKeyDeriver{hash: crypto.SHA384},
+	ECDH_SS_A256KW:          hkdfKeyDeriver{hash: crypto.SHA512},
+	PBES2_HS256_A128KW_HKDF: hkdfKeyDeriver{hash: crypto.SHA256},
+	PBES2_HS384_A192KW_HKDF: hkdfKeyDeriver{hash: crypto.SHA384},
+	PBES2_HS512_A256KW_HKDF: hkdfKeyDeriver{hash: crypto.SHA512},
+}
+
+// hkdfKeyDeriver derives a key of keySize bytes by reading that many bytes
+// from josecipher.NewHKDF(hash, secret, nil, apu||apv). The draft profiles
+// this backs have no salt of their own to contribute -- apu/apv serve the
+// same contextual-binding role ConcatKDF's OtherInfo plays for ECDH-ES.
+type hkdfKeyDeriver struct {
+	hash crypto.Hash
+}
+
+func (d hkdfKeyDeriver) deriveKey(secret, apu, apv []byte, keySize int) ([]byte, error) {
+	info := make([]byte, 0, len(apu)+len(apv))
+	info = append(info, apu...)
+	info = append(info, apv...)
+
+	reader := josecipher.NewHKDF(d.hash, secret, nil, info)
+
+	key := make([]byte, keySize)
+	if _, err := reader.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// DeriveKey derives the key-wrapping key of keySize bytes for alg from
+// secret, apu, and apv, using whichever KDF alg specifies. It returns an
+// error if alg is not a registered HKDF-based KeyAlgorithm.
+func DeriveKey(alg KeyAlgorithm, secret, apu, apv []byte, keySize int) ([]byte, error) {
+	deriver, ok := keyDerivers[alg]
+	if !ok {
+		return nil, errors.New("square/go-jose: unsupported KeyAlgorithm: " + string(alg))
+	}
+	return deriver.deriveKey(secret, apu, apv, keySize)
+}
@@ -0,0 +1,95 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jose
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestDeriveKeyLength(t *testing.T) {
+	algs := []struct {
+		alg     KeyAlgorithm
+		keySize int
+	}{
+		{ECDH_SS_A128KW, 16},
+		{ECDH_SS_A192KW, 24},
+		{ECDH_SS_A256KW, 32},
+		{PBES2_HS256_A128KW_HKDF, 16},
+		{PBES2_HS384_A192KW_HKDF, 24},
+		{PBES2_HS512_A256KW_HKDF, 32},
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	apu := []byte("alice")
+	apv := []byte("bob")
+
+	for _, c := range algs {
+		key, err := DeriveKey(c.alg, secret, apu, apv, c.keySize)
+		if err != nil {
+			t.Fatalf("%s: %v", c.alg, err)
+		}
+		if len(key) != c.keySize {
+			t.Fatalf("%s: expected %d byte key, got %d", c.alg, c.keySize, len(key))
+		}
+	}
+}
+
+func TestDeriveKeyIsDeterministic(t *testing.T) {
+	secret := []byte("shared secret material")
+	apu := []byte("alice")
+	apv := []byte("bob")
+
+	key1, err := DeriveKey(ECDH_SS_A256KW, secret, apu, apv, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := DeriveKey(ECDH_SS_A256KW, secret, apu, apv, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key1, key2) {
+		t.Fatal("DeriveKey produced different output for identical input")
+	}
+}
+
+func TestDeriveKeyBindsPartyInfo(t *testing.T) {
+	secret := []byte("shared secret material")
+
+	keyAliceBob, err := DeriveKey(ECDH_SS_A256KW, secret, []byte("alice"), []byte("bob"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAliceCarol, err := DeriveKey(ECDH_SS_A256KW, secret, []byte("alice"), []byte("carol"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(keyAliceBob, keyAliceCarol) {
+		t.Fatal("DeriveKey produced identical keys for different PartyVInfo")
+	}
+}
+
+func TestDeriveKeyRejectsUnsupportedAlgorithm(t *testing.T) {
+	if _, err := DeriveKey(ECDH_ES, []byte("secret"), nil, nil, 32); err == nil {
+		t.Fatal("expected error for an unregistered KeyAlgorithm, got none")
+	}
+}
@@ -0,0 +1,75 @@
+/*-
+ * Copyright 2014 Square Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package jose wires the primitives in josecipher up to the JOSE content
+// encryption and key management algorithms that select between them.
+package jose
+
+// ContentEncryption represents an algorithm used to encrypt a JWE payload,
+// as defined in RFC 7518, Section 5.1, plus the repo-local extensions
+// built on josecipher.
+type ContentEncryption string
+
+// ContentEncryption algorithm names.
+const (
+	A128CBC_HS256 ContentEncryption = "A128CBC-HS256"
+	A192CBC_HS384 ContentEncryption = "A192CBC-HS384"
+	A256CBC_HS512 ContentEncryption = "A256CBC-HS512"
+	A128GCM       ContentEncryption = "A128GCM"
+	A192GCM       ContentEncryption = "A192GCM"
+	A256GCM       ContentEncryption = "A256GCM"
+
+	// A256CBC_HS512_STREAM is a repo-local extension: A256CBC-HS512,
+	// framed through josecipher.NewEncryptWriter/NewDecryptReader so that Encrypter/Decrypter
+	// can handle payloads too large to hold in memory twice over.
+	A256CBC_HS512_STREAM ContentEncryption = "A256CBC-HS512-STREAM"
+
+	// A128GCM_SIV and A256GCM_SIV use AES-GCM-SIV (RFC 8452) in place of
+	// A*GCM: a nonce reused across two messages only reveals that the
+	// plaintexts (and AADs) were identical, rather than breaking
+	// confidentiality outright.
+	A128GCM_SIV ContentEncryption = "A128GCM-SIV"
+	A256GCM_SIV ContentEncryption = "A256GCM-SIV"
+)
+
+// KeyAlgorithm represents a key management algorithm, as defined in RFC
+// 7518, Section 4.1, plus the repo-local HKDF-based draft algorithms built
+// on josecipher.NewHKDF.
+type KeyAlgorithm string
+
+// KeyAlgorithm names.
+const (
+	ECDH_ES        KeyAlgorithm = "ECDH-ES"
+	ECDH_ES_A128KW KeyAlgorithm = "ECDH-ES+A128KW"
+	ECDH_ES_A192KW KeyAlgorithm = "ECDH-ES+A192KW"
+	ECDH_ES_A256KW KeyAlgorithm = "ECDH-ES+A256KW"
+
+	// ECDH_SS_A*KW are a draft static-static ECDH key agreement profile:
+	// unlike ECDH-ES, both parties use static (long-term) keys, so the
+	// derived key-wrapping key is bound to apu/apv via HKDF rather than
+	// ConcatKDF to avoid reusing ECDH-ES's KDF for a differently-shaped
+	// agreement.
+	ECDH_SS_A128KW KeyAlgorithm = "ECDH-SS+A128KW"
+	ECDH_SS_A192KW KeyAlgorithm = "ECDH-SS+A192KW"
+	ECDH_SS_A256KW KeyAlgorithm = "ECDH-SS+A256KW"
+
+	// PBES2_*_HKDF are a draft PBES2 profile that derives the key-wrapping
+	// key from the password-and-salt-derived secret with HKDF instead of
+	// reusing it directly as the AES-KW key.
+	PBES2_HS256_A128KW_HKDF KeyAlgorithm = "PBES2-HS256+A128KW+HKDF"
+	PBES2_HS384_A192KW_HKDF KeyAlgorithm = "PBES2-HS384+A192KW+HKDF"
+	PBES2_HS512_A256KW_HKDF KeyAlgorithm = "PBES2-HS512+A256KW+HKDF"
+)